@@ -0,0 +1,22 @@
+package cliconfig
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// MainFlags holds the persistent flags parsed at the top level, before any
+// subcommand name, and is copied into every PodmanCommand as GlobalFlags.
+type MainFlags struct {
+	Syslog   bool
+	LogLevel string
+	Remote   bool
+}
+
+// PodmanCommand is embedded by every per-command Values struct. It carries
+// the parsed cobra.Command, the command's positional arguments, and the
+// global flags parsed before the subcommand.
+type PodmanCommand struct {
+	*cobra.Command
+	InputArgs   []string
+	GlobalFlags MainFlags
+}
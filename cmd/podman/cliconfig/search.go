@@ -0,0 +1,19 @@
+package cliconfig
+
+import "time"
+
+// SearchValues is the parsed set of flags and args for "podman search".
+type SearchValues struct {
+	PodmanCommand
+	Authfile       string
+	Filter         []string
+	Format         string
+	Limit          int
+	NoTrunc        bool
+	TlsVerify      bool
+	Jobs           int
+	RequestTimeout time.Duration
+	ListTags       bool
+	CacheTTL       time.Duration
+	NoCache        bool
+}
@@ -5,21 +5,23 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/containers/image/docker"
 	"github.com/containers/image/types"
 	"github.com/containers/libpod/cmd/podman/cliconfig"
 	"github.com/containers/libpod/cmd/podman/formats"
 	"github.com/containers/libpod/libpod/common"
+	"github.com/containers/libpod/pkg/search"
 	sysreg "github.com/containers/libpod/pkg/registries"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 const (
 	descriptionTruncLength = 44
 	maxQueries             = 25
+	defaultSearchTemplate  = "table {{.Index}}\t{{.Name}}\t{{.Description}}\t{{.Stars}}\t{{.Official}}\t{{.Automated}}\t"
+	defaultTagsTemplate    = "table {{.Tag}}\t{{.Digest}}\t{{.Created}}\t"
 )
 
 var (
@@ -38,7 +40,9 @@ var (
 		},
 		Example: `podman search --filter=is-official --limit 3 alpine
   podman search registry.fedoraproject.org/  # only works with v2 registries
-  podman search --format "table {{.Index}} {{.Name}}" registry.fedoraproject.org/fedora`,
+  podman search --format "table {{.Index}} {{.Name}}" registry.fedoraproject.org/fedora
+  podman search --format json alpine
+  podman search --list-tags registry.fedoraproject.org/fedora`,
 	}
 )
 
@@ -48,19 +52,29 @@ func init() {
 	flags := searchCommand.Flags()
 	flags.StringVar(&searchCommand.Authfile, "authfile", "", "Path of the authentication file. Default is ${XDG_RUNTIME_DIR}/containers/auth.json. Use REGISTRY_AUTH_FILE environment variable to override")
 	flags.StringSliceVarP(&searchCommand.Filter, "filter", "f", []string{}, "Filter output based on conditions provided (default [])")
-	flags.StringVar(&searchCommand.Format, "format", "", "Change the output format to a Go template")
+	flags.StringVar(&searchCommand.Format, "format", "", "Change the output format to a Go template, \"json\", or \"yaml\"")
 	flags.IntVar(&searchCommand.Limit, "limit", 0, "Limit the number of results")
 	flags.BoolVar(&searchCommand.NoTrunc, "no-trunc", false, "Do not truncate the output")
 	flags.BoolVar(&searchCommand.TlsVerify, "tls-verify", true, "Require HTTPS and verify certificates when contacting registries (default: true)")
+	flags.IntVarP(&searchCommand.Jobs, "jobs", "j", 0, "Maximum number of registries to search in parallel (default: min(number of registries, 4))")
+	flags.DurationVar(&searchCommand.RequestTimeout, "request-timeout", 0, "Timeout for each registry search request, e.g. 5s, 1m (default: no timeout)")
+	flags.BoolVar(&searchCommand.ListTags, "list-tags", false, "List the tags of the image instead of searching repositories")
+	flags.DurationVar(&searchCommand.CacheTTL, "cache-ttl", 10*time.Minute, "How long to reuse a cached search result for the same query before re-querying the registry, e.g. 5m, 1h (0 disables the cache; TTL-only, no ETag revalidation)")
+	flags.BoolVar(&searchCommand.NoCache, "no-cache", false, "Do not read or write the on-disk search cache")
 }
 
+// searchParams is the table/JSON/YAML row shown for a single match. It
+// mirrors search.Result, but keeps Official/Automated as the "[OK]"/""
+// strings the table template has always printed.
 type searchParams struct {
+	Registry    string
 	Index       string
 	Name        string
 	Description string
 	Stars       int
 	Official    string
 	Automated   string
+	PullCommand string
 }
 
 type searchOpts struct {
@@ -70,12 +84,29 @@ type searchOpts struct {
 	format                string
 	authfile              string
 	insecureSkipTLSVerify types.OptionalBool
+	jobs                  int
+	requestTimeout        time.Duration
+	cacheTTL              time.Duration
+	noCache               bool
+	listTags              bool
 }
 
 type searchFilterParams struct {
 	stars       int
 	isAutomated *bool
 	isOfficial  *bool
+	tag         string
+	before      string
+	since       string
+}
+
+// tagParams is the table/JSON/YAML row shown for a single tag by
+// "podman search --list-tags".
+type tagParams struct {
+	Name    string
+	Tag     string
+	Digest  string
+	Created string
 }
 
 func searchCmd(c *cliconfig.SearchValues) error {
@@ -99,21 +130,33 @@ func searchCmd(c *cliconfig.SearchValues) error {
 
 	format := genSearchFormat(c.Format)
 	opts := searchOpts{
-		format:   format,
-		noTrunc:  c.NoTrunc,
-		limit:    c.Limit,
-		filter:   c.Filter,
-		authfile: getAuthFile(c.Authfile),
+		format:         format,
+		noTrunc:        c.NoTrunc,
+		limit:          c.Limit,
+		filter:         c.Filter,
+		authfile:       getAuthFile(c.Authfile),
+		jobs:           c.Jobs,
+		requestTimeout: c.RequestTimeout,
+		cacheTTL:       c.CacheTTL,
+		noCache:        c.NoCache,
+		listTags:       c.ListTags,
 	}
 	if c.Flag("tls-verify").Changed {
 		opts.insecureSkipTLSVerify = types.NewOptionalBool(!c.TlsVerify)
 	}
-	registries, err := getRegistries(registry)
+	filter, err := parseSearchFilter(&opts)
 	if err != nil {
 		return err
 	}
 
-	filter, err := parseSearchFilter(&opts)
+	if c.ListTags {
+		if registry == "" {
+			return errors.Errorf("--list-tags requires a search term with a registry, e.g. registry.example.com/repository")
+		}
+		return generateTagsOutput(registry+"/"+term, opts, *filter)
+	}
+
+	registries, err := getRegistries(registry)
 	if err != nil {
 		return err
 	}
@@ -121,16 +164,32 @@ func searchCmd(c *cliconfig.SearchValues) error {
 	return generateSearchOutput(term, registries, opts, *filter)
 }
 
+// newSearchSystemContext builds the *types.SystemContext shared by the
+// repository-search and --list-tags code paths.
+func newSearchSystemContext(opts searchOpts) *types.SystemContext {
+	sc := common.GetSystemContext("", opts.authfile, false)
+	sc.DockerInsecureSkipTLSVerify = opts.insecureSkipTLSVerify
+	sc.SystemRegistriesConfPath = sysreg.SystemRegistriesConfPath() // FIXME: Set this more globally.  Probably no reason not to have it in every types.SystemContext, and to compute the value just once in one place.
+	return sc
+}
+
+// genSearchFormat resolves the --format flag into either "json", "yaml", or
+// a Go template string to feed formats.StdoutTemplateArray.
 func genSearchFormat(format string) string {
-	if format != "" {
+	switch strings.ToLower(format) {
+	case "json", "yaml":
+		return strings.ToLower(format)
+	case "":
+		return defaultSearchTemplate
+	default:
 		// "\t" from the command line is not being recognized as a tab
 		// replacing the string "\t" to a tab character if the user passes in "\t"
 		return strings.Replace(format, `\t`, "\t", -1)
 	}
-	return "table {{.Index}}\t{{.Name}}\t{{.Description}}\t{{.Stars}}\t{{.Official}}\t{{.Automated}}\t"
 }
 
-func searchToGeneric(params []searchParams) (genericParams []interface{}) {
+func searchToGeneric(params []searchParams) []interface{} {
+	genericParams := make([]interface{}, 0, len(params))
 	for _, v := range params {
 		genericParams = append(genericParams, interface{}(v))
 	}
@@ -164,87 +223,207 @@ func getRegistries(registry string) ([]string, error) {
 	return registries, nil
 }
 
+// toSearchParams converts a pkg/search.Result into the CLI's display type,
+// truncating the description unless noTrunc is set.
+func toSearchParams(r search.Result, noTrunc bool) searchParams {
+	official := ""
+	if r.Official {
+		official = "[OK]"
+	}
+	automated := ""
+	if r.Automated {
+		automated = "[OK]"
+	}
+	description := r.Description
+	if len(description) > descriptionTruncLength && !noTrunc {
+		description = description[:descriptionTruncLength] + "..."
+	}
+	return searchParams{
+		Registry:    r.Registry,
+		Index:       r.Index,
+		Name:        r.Name,
+		Description: description,
+		Stars:       r.Stars,
+		Official:    official,
+		Automated:   automated,
+		PullCommand: r.PullCommand,
+	}
+}
+
+// resolveFilterRefCreated resolves a before=/since= filter reference's
+// creation time, bounded by requestTimeout the same way the per-registry
+// search and per-tag manifest fetches already are, so an unreachable or
+// slow registry named in the filter can't hang the command forever.
+func resolveFilterRefCreated(ctx context.Context, sc *types.SystemContext, ref string, requestTimeout time.Duration) (time.Time, error) {
+	if requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+	}
+	return search.ResolveRefCreated(ctx, sc, ref)
+}
+
 func getSearchOutput(term string, registries []string, opts searchOpts, filter searchFilterParams) ([]searchParams, error) {
-	// Max number of queries by default is 25
+	sc := newSearchSystemContext(opts)
+	ctx := context.TODO()
+
 	limit := maxQueries
 	if opts.limit != 0 {
 		limit = opts.limit
 	}
-
-	sc := common.GetSystemContext("", opts.authfile, false)
-	sc.DockerInsecureSkipTLSVerify = opts.insecureSkipTLSVerify
-	sc.SystemRegistriesConfPath = sysreg.SystemRegistriesConfPath() // FIXME: Set this more globally.  Probably no reason not to have it in every types.SystemContext, and to compute the value just once in one place.
-	var paramsArr []searchParams
-	for _, reg := range registries {
-		results, err := docker.SearchRegistry(context.TODO(), sc, reg, term, limit)
+	filterParams := search.FilterParams{
+		Stars:       filter.stars,
+		IsAutomated: filter.isAutomated,
+		IsOfficial:  filter.isOfficial,
+	}
+	if filter.before != "" {
+		before, err := resolveFilterRefCreated(ctx, sc, filter.before, opts.requestTimeout)
 		if err != nil {
-			logrus.Errorf("error searching registry %q: %v", reg, err)
-			continue
+			return nil, errors.Wrapf(err, "error resolving `before` filter reference %q", filter.before)
 		}
-		index := reg
-		arr := strings.Split(reg, ".")
-		if len(arr) > 2 {
-			index = strings.Join(arr[len(arr)-2:], ".")
+		filterParams.Before = &before
+	}
+	if filter.since != "" {
+		since, err := resolveFilterRefCreated(ctx, sc, filter.since, opts.requestTimeout)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error resolving `since` filter reference %q", filter.since)
 		}
+		filterParams.Since = &since
+	}
+	searchOpts := search.Options{
+		Limit:                 limit,
+		Jobs:                  opts.jobs,
+		RequestTimeout:        opts.requestTimeout,
+		InsecureSkipTLSVerify: opts.insecureSkipTLSVerify,
+		Filter:                filterParams,
+		CacheTTL:              opts.cacheTTL,
+		NoCache:               opts.noCache,
+	}
+
+	// noTrunc only matters when we actually render a description; the
+	// JSON/YAML paths want the full, untruncated text regardless.
+	noTrunc := opts.noTrunc || opts.format == "json" || opts.format == "yaml"
+
+	results, searchErr := search.Search(ctx, sc, term, registries, searchOpts)
+	paramsArr := make([]searchParams, 0, len(results))
+	for _, r := range results {
+		paramsArr = append(paramsArr, toSearchParams(r, noTrunc))
+	}
+	return paramsArr, searchErr
+}
+
+func generateSearchOutput(term string, registries []string, opts searchOpts, filter searchFilterParams) error {
+	searchOutput, searchErr := getSearchOutput(term, registries, opts, filter)
 
-		// limit is the number of results to output
-		// if the total number of results is less than the limit, output all
-		// if the limit has been set by the user, output those number of queries
-		limit := maxQueries
-		if len(results) < limit {
-			limit = len(results)
+	// json/yaml are scripting-friendly formats: always emit a parseable
+	// empty document ("[]"/"--- []") on zero matches instead of silently
+	// printing nothing.
+	switch opts.format {
+	case "json":
+		if err := (formats.JSONStructArray{Output: searchToGeneric(searchOutput)}).Out(); err != nil {
+			return err
 		}
-		if opts.limit != 0 && opts.limit < len(results) {
-			limit = opts.limit
+		return searchErr
+	case "yaml":
+		if err := (formats.YAMLStructArray{Output: searchToGeneric(searchOutput)}).Out(); err != nil {
+			return err
 		}
+		return searchErr
+	}
 
-		for i := 0; i < limit; i++ {
-			if len(opts.filter) > 0 {
-				// Check whether query matches filters
-				if !(matchesAutomatedFilter(filter, results[i]) && matchesOfficialFilter(filter, results[i]) && matchesStarFilter(filter, results[i])) {
-					continue
-				}
-			}
-			official := ""
-			if results[i].IsOfficial {
-				official = "[OK]"
-			}
-			automated := ""
-			if results[i].IsAutomated {
-				automated = "[OK]"
-			}
-			description := strings.Replace(results[i].Description, "\n", " ", -1)
-			if len(description) > 44 && !opts.noTrunc {
-				description = description[:descriptionTruncLength] + "..."
-			}
-			name := reg + "/" + results[i].Name
-			if index == "docker.io" && !strings.Contains(results[i].Name, "/") {
-				name = index + "/library/" + results[i].Name
-			}
-			params := searchParams{
-				Index:       index,
-				Name:        name,
-				Description: description,
-				Official:    official,
-				Automated:   automated,
-				Stars:       results[i].StarCount,
-			}
-			paramsArr = append(paramsArr, params)
+	if len(searchOutput) == 0 {
+		if searchErr != nil {
+			return searchErr
 		}
+		return nil
+	}
+	out := formats.StdoutTemplateArray{Output: searchToGeneric(searchOutput), Template: opts.format, Fields: searchOutput[0].headerMap()}
+	if err := out.Out(); err != nil {
+		return err
 	}
-	return paramsArr, nil
+	return searchErr
 }
 
-func generateSearchOutput(term string, registries []string, opts searchOpts, filter searchFilterParams) error {
-	searchOutput, err := getSearchOutput(term, registries, opts, filter)
+func tagsToGeneric(params []tagParams) []interface{} {
+	genericParams := make([]interface{}, 0, len(params))
+	for _, v := range params {
+		genericParams = append(genericParams, interface{}(v))
+	}
+	return genericParams
+}
+
+func (t *tagParams) headerMap() map[string]string {
+	v := reflect.Indirect(reflect.ValueOf(t))
+	values := make(map[string]string, v.NumField())
+
+	for i := 0; i < v.NumField(); i++ {
+		key := v.Type().Field(i).Name
+		values[key] = strings.ToUpper(splitCamelCase(key))
+	}
+	return values
+}
+
+// generateTagsOutput implements "podman search --list-tags": repo must be a
+// concrete "registry/repository" reference, not a search term.
+func generateTagsOutput(repo string, opts searchOpts, filter searchFilterParams) error {
+	sc := newSearchSystemContext(opts)
+	ctx := context.TODO()
+
+	tagFilter := search.TagFilterParams{TagGlob: filter.tag}
+	if filter.before != "" {
+		before, err := resolveFilterRefCreated(ctx, sc, filter.before, opts.requestTimeout)
+		if err != nil {
+			return errors.Wrapf(err, "error resolving `before` filter reference %q", filter.before)
+		}
+		tagFilter.Before = &before
+	}
+	if filter.since != "" {
+		since, err := resolveFilterRefCreated(ctx, sc, filter.since, opts.requestTimeout)
+		if err != nil {
+			return errors.Wrapf(err, "error resolving `since` filter reference %q", filter.since)
+		}
+		tagFilter.Since = &since
+	}
+
+	tagOpts := search.TagOptions{
+		RequestTimeout: opts.requestTimeout,
+		CacheTTL:       opts.cacheTTL,
+		NoCache:        opts.noCache,
+	}
+	tags, err := search.ListTags(ctx, sc, repo, tagFilter, tagOpts)
 	if err != nil {
 		return err
 	}
-	if len(searchOutput) == 0 {
+
+	tagOutput := make([]tagParams, 0, len(tags))
+	for _, t := range tags {
+		tagOutput = append(tagOutput, tagParams{
+			Name:    t.Name,
+			Tag:     t.Tag,
+			Digest:  t.Digest,
+			Created: t.Created.Format(time.RFC3339),
+		})
+	}
+
+	// json/yaml are scripting-friendly formats: always emit a parseable
+	// empty document ("[]"/"--- []") on zero matches instead of silently
+	// printing nothing.
+	switch opts.format {
+	case "json":
+		return (formats.JSONStructArray{Output: tagsToGeneric(tagOutput)}).Out()
+	case "yaml":
+		return (formats.YAMLStructArray{Output: tagsToGeneric(tagOutput)}).Out()
+	}
+
+	if len(tagOutput) == 0 {
 		return nil
 	}
-	out := formats.StdoutTemplateArray{Output: searchToGeneric(searchOutput), Template: opts.format, Fields: searchOutput[0].headerMap()}
-	return formats.Writer(out).Out()
+	template := opts.format
+	if template == defaultSearchTemplate {
+		template = defaultTagsTemplate
+	}
+	out := formats.StdoutTemplateArray{Output: tagsToGeneric(tagOutput), Template: template, Fields: tagOutput[0].headerMap()}
+	return out.Out()
 }
 
 func parseSearchFilter(opts *searchOpts) (*searchFilterParams, error) {
@@ -278,27 +457,30 @@ func parseSearchFilter(opts *searchOpts) (*searchFilterParams, error) {
 				filterParams.isOfficial = &ptrTrue
 			}
 			break
+		case "tag":
+			if !opts.listTags {
+				return nil, errors.Errorf("`tag` filter is only valid with --list-tags")
+			}
+			if len(arr) < 2 {
+				return nil, errors.Errorf("invalid `tag` filter %q, should be tag=<glob>", filter)
+			}
+			filterParams.tag = arr[1]
+			break
+		case "before":
+			if len(arr) < 2 {
+				return nil, errors.Errorf("invalid `before` filter %q, should be before=<reference>", filter)
+			}
+			filterParams.before = arr[1]
+			break
+		case "since":
+			if len(arr) < 2 {
+				return nil, errors.Errorf("invalid `since` filter %q, should be since=<reference>", filter)
+			}
+			filterParams.since = arr[1]
+			break
 		default:
 			return nil, errors.Errorf("invalid filter type %q", filter)
 		}
 	}
 	return filterParams, nil
 }
-
-func matchesStarFilter(filter searchFilterParams, result docker.SearchResult) bool {
-	return result.StarCount >= filter.stars
-}
-
-func matchesAutomatedFilter(filter searchFilterParams, result docker.SearchResult) bool {
-	if filter.isAutomated != nil {
-		return result.IsAutomated == *filter.isAutomated
-	}
-	return true
-}
-
-func matchesOfficialFilter(filter searchFilterParams, result docker.SearchResult) bool {
-	if filter.isOfficial != nil {
-		return result.IsOfficial == *filter.isOfficial
-	}
-	return true
-}
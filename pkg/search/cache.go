@@ -0,0 +1,145 @@
+package search
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containers/image/docker"
+)
+
+// cacheEntry is the on-disk representation of one cached search, keyed by
+// (registry, term, limit). docker.SearchRegistry decodes the registry's
+// response and doesn't surface its HTTP headers, so there is no ETag or
+// Last-Modified value to revalidate against here; entries are fresh purely
+// based on Timestamp and the caller-supplied TTL.
+type cacheEntry struct {
+	Results   []docker.SearchResult `json:"results"`
+	Timestamp time.Time             `json:"timestamp"`
+}
+
+// cacheRoot returns $XDG_CACHE_HOME/containers/search, falling back to
+// ~/.cache/containers/search when XDG_CACHE_HOME is unset.
+func cacheRoot() (string, error) {
+	base := os.Getenv("XDG_CACHE_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(base, "containers", "search"), nil
+}
+
+func cachePath(registry, term string, limit int) (string, error) {
+	root, err := cacheRoot()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d", registry, term, limit)))
+	return filepath.Join(root, hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// loadCachedResults returns the cached SearchRegistry results for
+// (registry, term, limit), if a fresh-enough (within ttl) entry is on
+// disk. A missing or unreadable entry is treated as a cache miss, never
+// an error. A stale entry is evicted (deleted) on the spot so the cache
+// directory doesn't grow forever.
+func loadCachedResults(registry, term string, limit int, ttl time.Duration) ([]docker.SearchResult, bool) {
+	path, err := cachePath(registry, term, limit)
+	if err != nil {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	if time.Since(entry.Timestamp) > ttl {
+		_ = os.Remove(path)
+		return nil, false
+	}
+	return entry.Results, true
+}
+
+// saveCachedResults writes results for (registry, term, limit) to disk,
+// lazily creating the cache directory. Write failures are ignored: the
+// cache is an optimization, not a correctness requirement.
+func saveCachedResults(registry, term string, limit int, results []docker.SearchResult) {
+	path, err := cachePath(registry, term, limit)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return
+	}
+	data, err := json.Marshal(cacheEntry{Results: results, Timestamp: time.Now()})
+	if err != nil {
+		return
+	}
+	_ = ioutil.WriteFile(path, data, 0o600)
+}
+
+// tagCacheEntry is the on-disk representation of one cached --list-tags
+// manifest resolution, keyed by (repo, tag).
+type tagCacheEntry struct {
+	Result    TagResult `json:"result"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func tagCachePath(repo, tag string) (string, error) {
+	root, err := cacheRoot()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("tag\x00%s\x00%s", repo, tag)))
+	return filepath.Join(root, hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// loadCachedTag mirrors loadCachedResults for a single (repo, tag)
+// manifest resolution, evicting a stale entry on the spot.
+func loadCachedTag(repo, tag string, ttl time.Duration) (TagResult, bool) {
+	path, err := tagCachePath(repo, tag)
+	if err != nil {
+		return TagResult{}, false
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return TagResult{}, false
+	}
+	var entry tagCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return TagResult{}, false
+	}
+	if time.Since(entry.Timestamp) > ttl {
+		_ = os.Remove(path)
+		return TagResult{}, false
+	}
+	return entry.Result, true
+}
+
+// saveCachedTag mirrors saveCachedResults for a single (repo, tag)
+// manifest resolution.
+func saveCachedTag(repo, tag string, result TagResult) {
+	path, err := tagCachePath(repo, tag)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return
+	}
+	data, err := json.Marshal(tagCacheEntry{Result: result, Timestamp: time.Now()})
+	if err != nil {
+		return
+	}
+	_ = ioutil.WriteFile(path, data, 0o600)
+}
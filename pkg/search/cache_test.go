@@ -0,0 +1,122 @@
+package search
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/containers/image/docker"
+)
+
+// withTempCacheRoot points XDG_CACHE_HOME at a fresh temp dir for the
+// duration of the test, so cache tests never touch the real user cache.
+func withTempCacheRoot(t *testing.T) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "podman-search-cache")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	old, hadOld := os.LookupEnv("XDG_CACHE_HOME")
+	if err := os.Setenv("XDG_CACHE_HOME", dir); err != nil {
+		t.Fatalf("os.Setenv: %v", err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+		if hadOld {
+			os.Setenv("XDG_CACHE_HOME", old)
+		} else {
+			os.Unsetenv("XDG_CACHE_HOME")
+		}
+	})
+}
+
+func TestCachePathIsStableAndKeyedByInputs(t *testing.T) {
+	withTempCacheRoot(t)
+
+	p1, err := cachePath("docker.io", "alpine", 25)
+	if err != nil {
+		t.Fatalf("cachePath: %v", err)
+	}
+	p2, err := cachePath("docker.io", "alpine", 25)
+	if err != nil {
+		t.Fatalf("cachePath: %v", err)
+	}
+	if p1 != p2 {
+		t.Errorf("cachePath should be stable for identical inputs: %q != %q", p1, p2)
+	}
+
+	for _, other := range []struct {
+		reg, term string
+		limit     int
+	}{
+		{"quay.io", "alpine", 25},
+		{"docker.io", "busybox", 25},
+		{"docker.io", "alpine", 10},
+	} {
+		p, err := cachePath(other.reg, other.term, other.limit)
+		if err != nil {
+			t.Fatalf("cachePath: %v", err)
+		}
+		if p == p1 {
+			t.Errorf("cachePath(%q, %q, %d) collided with cachePath(docker.io, alpine, 25)", other.reg, other.term, other.limit)
+		}
+	}
+}
+
+func TestSaveAndLoadCachedResults(t *testing.T) {
+	withTempCacheRoot(t)
+
+	results := []docker.SearchResult{{Name: "alpine", StarCount: 42}}
+	saveCachedResults("docker.io", "alpine", 25, results)
+
+	got, ok := loadCachedResults("docker.io", "alpine", 25, time.Hour)
+	if !ok {
+		t.Fatal("expected a cache hit right after saving")
+	}
+	if len(got) != 1 || got[0].Name != "alpine" || got[0].StarCount != 42 {
+		t.Errorf("loadCachedResults returned %+v, want the saved results", got)
+	}
+
+	if _, ok := loadCachedResults("docker.io", "busybox", 25, time.Hour); ok {
+		t.Error("expected a miss for a different search key")
+	}
+}
+
+func TestLoadCachedResultsEvictsStaleEntry(t *testing.T) {
+	withTempCacheRoot(t)
+
+	saveCachedResults("docker.io", "alpine", 25, []docker.SearchResult{{Name: "alpine"}})
+
+	// A TTL of zero duration makes the just-written entry already stale.
+	if _, ok := loadCachedResults("docker.io", "alpine", 25, 0); ok {
+		t.Fatal("expected the entry to be treated as stale with a zero TTL")
+	}
+
+	path, err := cachePath("docker.io", "alpine", 25)
+	if err != nil {
+		t.Fatalf("cachePath: %v", err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Error("stale cache entry should have been evicted from disk, but the file still exists")
+	}
+}
+
+func TestSaveAndLoadCachedTag(t *testing.T) {
+	withTempCacheRoot(t)
+
+	want := TagResult{Name: "docker.io/library/alpine", Tag: "3.18", Digest: "sha256:deadbeef", Created: time.Now().Truncate(time.Second)}
+	saveCachedTag(want.Name, want.Tag, want)
+
+	got, ok := loadCachedTag(want.Name, want.Tag, time.Hour)
+	if !ok {
+		t.Fatal("expected a cache hit right after saving")
+	}
+	if got.Name != want.Name || got.Tag != want.Tag || got.Digest != want.Digest || !got.Created.Equal(want.Created) {
+		t.Errorf("loadCachedTag = %+v, want %+v", got, want)
+	}
+
+	if _, ok := loadCachedTag(want.Name, "3.17", time.Hour); ok {
+		t.Error("expected a miss for a different tag")
+	}
+}
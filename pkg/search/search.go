@@ -0,0 +1,400 @@
+// Package search implements the registry search logic behind "podman
+// search", exposed as a library so other Go programs can query configured
+// registries for matching repositories without shelling out to podman.
+package search
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containers/image/docker"
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/types"
+	"github.com/pkg/errors"
+)
+
+// DefaultJobs is the number of registries searched concurrently when
+// Options.Jobs is left at zero.
+const DefaultJobs = 4
+
+// DefaultLimit is the per-registry result cap used when Options.Limit is
+// left at zero. Most v1 registries treat a limit of 0 as "return nothing"
+// rather than "no limit", so a zero-value Options must not be passed
+// through to docker.SearchRegistry as-is.
+const DefaultLimit = 25
+
+// Result is a single repository match from one registry. Description is
+// never truncated here; truncating for display is the caller's job.
+type Result struct {
+	Registry    string
+	Index       string
+	Name        string
+	Description string
+	Stars       int
+	Official    bool
+	Automated   bool
+	PullCommand string
+}
+
+// FilterParams mirrors the filters accepted by "podman search --filter".
+// Before/Since, when set, drop repositories whose "latest" tag was not
+// created within the window, and repositories whose "latest" manifest
+// cannot be fetched; resolving them costs one extra manifest fetch per
+// surviving result.
+type FilterParams struct {
+	Stars       int
+	IsAutomated *bool
+	IsOfficial  *bool
+	Before      *time.Time
+	Since       *time.Time
+}
+
+// Options controls how Search queries the configured registries.
+type Options struct {
+	// Limit caps the number of results returned per registry. Zero or
+	// negative defaults to DefaultLimit; it is not treated as "no limit".
+	Limit                 int
+	Filter                FilterParams
+	Jobs                  int
+	RequestTimeout        time.Duration
+	InsecureSkipTLSVerify types.OptionalBool
+	// CacheTTL is how long a cached SearchRegistry response for a given
+	// (registry, term, limit) stays fresh; zero disables the on-disk cache.
+	CacheTTL time.Duration
+	// NoCache bypasses the on-disk cache entirely: no read, no write.
+	NoCache bool
+}
+
+// MultiError aggregates the per-registry errors encountered while searching.
+type MultiError struct {
+	Errors []error
+}
+
+func (m *MultiError) Error() string {
+	msgs := make([]string, 0, len(m.Errors))
+	for _, err := range m.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type indexedResults struct {
+	index   int
+	results []Result
+	err     error
+}
+
+func limitOrDefault(limit int) int {
+	if limit <= 0 {
+		return DefaultLimit
+	}
+	return limit
+}
+
+func jobCount(opts Options, numRegistries int) int {
+	if opts.Jobs > 0 {
+		return opts.Jobs
+	}
+	jobs := numRegistries
+	if jobs > DefaultJobs {
+		jobs = DefaultJobs
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+	return jobs
+}
+
+func matchesFilter(filter FilterParams, result docker.SearchResult) bool {
+	if result.StarCount < filter.Stars {
+		return false
+	}
+	if filter.IsAutomated != nil && result.IsAutomated != *filter.IsAutomated {
+		return false
+	}
+	if filter.IsOfficial != nil && result.IsOfficial != *filter.IsOfficial {
+		return false
+	}
+	return true
+}
+
+// matchesTagGlob reports whether tag matches glob, a path.Match pattern.
+// An empty glob matches every tag, and a malformed glob matches none.
+func matchesTagGlob(glob, tag string) bool {
+	if glob == "" {
+		return true
+	}
+	ok, err := path.Match(glob, tag)
+	return err == nil && ok
+}
+
+// withinWindow reports whether created falls within the (before, since)
+// bounds: strictly before `before` when set, strictly after `since` when
+// set. Either bound left nil is not enforced.
+func withinWindow(before, since *time.Time, created time.Time) bool {
+	if before != nil && !created.Before(*before) {
+		return false
+	}
+	if since != nil && !created.After(*since) {
+		return false
+	}
+	return true
+}
+
+// resolveCreated resolves the manifest creation time of an image reference
+// such as "registry.example.com/library/alpine" (optionally with a tag),
+// for use as a search or tag-listing filter window bound.
+func resolveCreated(ctx context.Context, sc *types.SystemContext, imageRef string) (time.Time, error) {
+	ref, err := docker.ParseReference("//" + imageRef)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "error parsing reference %q", imageRef)
+	}
+	created, _, err := inspectRef(ctx, sc, ref)
+	return created, err
+}
+
+// ResolveRefCreated is the exported form of resolveCreated, letting callers
+// turn a --filter before=<ref>/since=<ref> value into the time.Time that
+// FilterParams.Before/Since and TagFilterParams.Before/Since expect.
+func ResolveRefCreated(ctx context.Context, sc *types.SystemContext, imageRef string) (time.Time, error) {
+	return resolveCreated(ctx, sc, imageRef)
+}
+
+// inspectRef fetches an image reference's manifest to get its creation
+// time and digest, used by the before=/since= filters and --list-tags.
+func inspectRef(ctx context.Context, sc *types.SystemContext, ref types.ImageReference) (time.Time, string, error) {
+	img, err := ref.NewImage(ctx, sc)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	defer img.Close()
+
+	inspect, err := img.Inspect(ctx)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	manifestBlob, _, err := img.Manifest(ctx)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	dgst, err := manifest.Digest(manifestBlob)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	var created time.Time
+	if inspect.Created != nil {
+		created = *inspect.Created
+	}
+	return created, dgst.String(), nil
+}
+
+func searchOneRegistry(ctx context.Context, sc *types.SystemContext, term, reg string, opts Options) ([]Result, error) {
+	if opts.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.RequestTimeout)
+		defer cancel()
+	}
+
+	limit := limitOrDefault(opts.Limit)
+
+	useCache := !opts.NoCache && opts.CacheTTL > 0
+	raw, hit := []docker.SearchResult(nil), false
+	if useCache {
+		raw, hit = loadCachedResults(reg, term, limit, opts.CacheTTL)
+	}
+	if !hit {
+		var err error
+		raw, err = docker.SearchRegistry(ctx, sc, reg, term, limit)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error searching registry %q", reg)
+		}
+		if useCache {
+			saveCachedResults(reg, term, limit, raw)
+		}
+	}
+
+	index := reg
+	if arr := strings.Split(reg, "."); len(arr) > 2 {
+		index = strings.Join(arr[len(arr)-2:], ".")
+	}
+
+	max := len(raw)
+	if limit < max {
+		max = limit
+	}
+
+	var out []Result
+	for _, r := range raw[:max] {
+		if !matchesFilter(opts.Filter, r) {
+			continue
+		}
+		name := reg + "/" + r.Name
+		if index == "docker.io" && !strings.Contains(r.Name, "/") {
+			name = index + "/library/" + r.Name
+		}
+		if opts.Filter.Before != nil || opts.Filter.Since != nil {
+			created, err := resolveCreated(ctx, sc, name)
+			if err != nil {
+				// Can't place this result in the window, so leave it out
+				// rather than guessing.
+				continue
+			}
+			if !withinWindow(opts.Filter.Before, opts.Filter.Since, created) {
+				continue
+			}
+		}
+		out = append(out, Result{
+			Registry:    reg,
+			Index:       index,
+			Name:        name,
+			Description: strings.Replace(r.Description, "\n", " ", -1),
+			Stars:       r.StarCount,
+			Official:    r.IsOfficial,
+			Automated:   r.IsAutomated,
+			PullCommand: "podman pull " + name,
+		})
+	}
+	return out, nil
+}
+
+// Search queries term against registries in parallel, bounded by
+// Options.Jobs, and returns the matches merged back in the original
+// registry order. If one or more registries fail, Search still returns
+// whatever results the other registries produced, alongside a non-nil
+// *MultiError describing the failures.
+func Search(ctx context.Context, sc *types.SystemContext, term string, registries []string, opts Options) ([]Result, error) {
+	jobs := jobCount(opts, len(registries))
+	sem := make(chan struct{}, jobs)
+	resultsCh := make(chan indexedResults, len(registries))
+	var wg sync.WaitGroup
+
+	for i, reg := range registries {
+		wg.Add(1)
+		go func(i int, reg string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results, err := searchOneRegistry(ctx, sc, term, reg, opts)
+			resultsCh <- indexedResults{index: i, results: results, err: err}
+		}(i, reg)
+	}
+	wg.Wait()
+	close(resultsCh)
+
+	ordered := make([][]Result, len(registries))
+	var multiErr *MultiError
+	for res := range resultsCh {
+		if res.err != nil {
+			if multiErr == nil {
+				multiErr = &MultiError{}
+			}
+			multiErr.Errors = append(multiErr.Errors, res.err)
+			continue
+		}
+		ordered[res.index] = res.results
+	}
+
+	var all []Result
+	for _, results := range ordered {
+		all = append(all, results...)
+	}
+	if multiErr != nil {
+		return all, multiErr
+	}
+	return all, nil
+}
+
+// TagResult is a single tag of a concrete repository, as returned by
+// ListTags (podman search --list-tags).
+type TagResult struct {
+	Name    string
+	Tag     string
+	Digest  string
+	Created time.Time
+}
+
+// TagFilterParams narrows the tags ListTags returns: TagGlob matches tag
+// names (as path.Match patterns), Before/Since bound the manifest's
+// creation time.
+type TagFilterParams struct {
+	TagGlob string
+	Before  *time.Time
+	Since   *time.Time
+}
+
+// TagOptions controls how ListTags fetches each tag's manifest:
+// RequestTimeout bounds the per-tag fetch (the same knob --request-timeout
+// gives repository search), and CacheTTL/NoCache gate an on-disk cache of
+// resolved (repo, tag) manifests, mirroring Options' cache for repository
+// search. This matters most against slow private v2 registries, where
+// --list-tags otherwise does one unbounded, uncached fetch per tag.
+type TagOptions struct {
+	RequestTimeout time.Duration
+	CacheTTL       time.Duration
+	NoCache        bool
+}
+
+// ListTags queries the registry's v2 "/tags/list" endpoint for repo (e.g.
+// "registry.example.com/library/alpine") and returns one TagResult per
+// matching tag, with its manifest digest and creation time resolved. Tags
+// whose manifest cannot be fetched are left out of the result.
+func ListTags(ctx context.Context, sc *types.SystemContext, repo string, filter TagFilterParams, opts TagOptions) ([]TagResult, error) {
+	ref, err := docker.ParseReference("//" + repo)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing repository reference %q", repo)
+	}
+	tags, err := docker.GetRepositoryTags(ctx, sc, ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing tags for %q", repo)
+	}
+
+	useCache := !opts.NoCache && opts.CacheTTL > 0
+	results := make([]TagResult, 0, len(tags))
+	for _, tag := range tags {
+		if !matchesTagGlob(filter.TagGlob, tag) {
+			continue
+		}
+
+		result, ok := TagResult{}, false
+		if useCache {
+			result, ok = loadCachedTag(repo, tag, opts.CacheTTL)
+		}
+		if !ok {
+			tagRef, err := docker.ParseReference(fmt.Sprintf("//%s:%s", repo, tag))
+			if err != nil {
+				return nil, errors.Wrapf(err, "error parsing reference for %s:%s", repo, tag)
+			}
+
+			tagCtx := ctx
+			var cancel context.CancelFunc
+			if opts.RequestTimeout > 0 {
+				tagCtx, cancel = context.WithTimeout(ctx, opts.RequestTimeout)
+			}
+			created, dgst, err := inspectRef(tagCtx, sc, tagRef)
+			if cancel != nil {
+				cancel()
+			}
+			if err != nil {
+				// A single unreadable tag (e.g. a manifest-list quirk)
+				// shouldn't abort the rest of the listing.
+				continue
+			}
+			result = TagResult{Name: repo, Tag: tag, Digest: dgst, Created: created}
+			if useCache {
+				saveCachedTag(repo, tag, result)
+			}
+		}
+
+		if !withinWindow(filter.Before, filter.Since, result.Created) {
+			continue
+		}
+
+		results = append(results, result)
+	}
+	return results, nil
+}
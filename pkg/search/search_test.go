@@ -0,0 +1,139 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/containers/image/docker"
+)
+
+func TestJobCount(t *testing.T) {
+	cases := []struct {
+		name          string
+		optsJobs      int
+		numRegistries int
+		want          int
+	}{
+		{"explicit jobs wins", 2, 10, 2},
+		{"defaults to DefaultJobs when more registries than that", 0, 10, DefaultJobs},
+		{"defaults to registry count when fewer than DefaultJobs", 0, 2, 2},
+		{"never goes below one", 0, 0, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := jobCount(Options{Jobs: tc.optsJobs}, tc.numRegistries)
+			if got != tc.want {
+				t.Errorf("jobCount(%d, %d) = %d, want %d", tc.optsJobs, tc.numRegistries, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLimitOrDefault(t *testing.T) {
+	cases := []struct {
+		name  string
+		limit int
+		want  int
+	}{
+		{"zero defaults to DefaultLimit", 0, DefaultLimit},
+		{"negative defaults to DefaultLimit", -1, DefaultLimit},
+		{"positive limit is kept as-is", 5, 5},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := limitOrDefault(tc.limit); got != tc.want {
+				t.Errorf("limitOrDefault(%d) = %d, want %d", tc.limit, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMultiErrorError(t *testing.T) {
+	err := &MultiError{}
+	if got := err.Error(); got != "" {
+		t.Errorf("empty MultiError.Error() = %q, want empty string", got)
+	}
+
+	err.Errors = []error{errString("registry a failed"), errString("registry b failed")}
+	want := "registry a failed; registry b failed"
+	if got := err.Error(); got != want {
+		t.Errorf("MultiError.Error() = %q, want %q", got, want)
+	}
+}
+
+type errString string
+
+func (e errString) Error() string { return string(e) }
+
+func TestMatchesFilter(t *testing.T) {
+	automated := docker.SearchResult{StarCount: 5, IsAutomated: true, IsOfficial: false}
+	official := docker.SearchResult{StarCount: 1, IsAutomated: false, IsOfficial: true}
+
+	ptrTrue := true
+	ptrFalse := false
+
+	cases := []struct {
+		name   string
+		filter FilterParams
+		result docker.SearchResult
+		want   bool
+	}{
+		{"no filter matches everything", FilterParams{}, automated, true},
+		{"stars filter excludes low star count", FilterParams{Stars: 10}, automated, false},
+		{"stars filter includes equal star count", FilterParams{Stars: 5}, automated, true},
+		{"is-automated=true excludes non-automated", FilterParams{IsAutomated: &ptrTrue}, official, false},
+		{"is-automated=false excludes automated", FilterParams{IsAutomated: &ptrFalse}, automated, false},
+		{"is-official=true excludes non-official", FilterParams{IsOfficial: &ptrTrue}, automated, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := matchesFilter(tc.filter, tc.result); got != tc.want {
+				t.Errorf("matchesFilter() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMatchesTagGlob(t *testing.T) {
+	cases := []struct {
+		glob, tag string
+		want      bool
+	}{
+		{"", "latest", true},
+		{"3.*", "3.18", true},
+		{"3.*", "latest", false},
+		{"[", "latest", false}, // malformed pattern: matches nothing, doesn't panic/error out
+	}
+	for _, tc := range cases {
+		if got := matchesTagGlob(tc.glob, tc.tag); got != tc.want {
+			t.Errorf("matchesTagGlob(%q, %q) = %v, want %v", tc.glob, tc.tag, got, tc.want)
+		}
+	}
+}
+
+func TestWithinWindow(t *testing.T) {
+	base := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	before := base.Add(24 * time.Hour)
+	since := base.Add(-24 * time.Hour)
+
+	cases := []struct {
+		name          string
+		before, since *time.Time
+		created       time.Time
+		want          bool
+	}{
+		{"no bounds always matches", nil, nil, base, true},
+		{"inside window", &before, &since, base, true},
+		{"on or after before bound is excluded", &before, nil, before, false},
+		{"strictly before the before bound matches", &before, nil, base, true},
+		{"on or before since bound is excluded", nil, &since, since, false},
+		{"strictly after the since bound matches", nil, &since, base, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := withinWindow(tc.before, tc.since, tc.created); got != tc.want {
+				t.Errorf("withinWindow() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}